@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// ChunkDecompressor is implemented by Compressors that can also decode their
+// own output, mirroring the NewWriter side used when chunks are uploaded.
+// Every chunk is compressed on upload (see PushStreamToDestinationDeduped),
+// so a compressor that doesn't implement this can't restore deduped chunks
+// at all; restoreChunk fails loudly rather than passing the bytes through.
+type ChunkDecompressor interface {
+	NewDecompressingReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// ChunkDecrypter mirrors crypto.Crypter's Decrypt method, which is what
+// ConfigureCrypter's encryption side (via CompressAndEncrypt) actually
+// implements when chunks are uploaded.
+type ChunkDecrypter interface {
+	Decrypt(r io.Reader) (io.Reader, error)
+}
+
+// RestoreStream reassembles dstPath by reading the chunk manifest and
+// fetching its referenced chunks, in order, decompressing and decrypting
+// each one before writing it to dst. It is the inverse of
+// PushStreamToDestinationDeduped. Chunk boundaries come from the manifest,
+// so no chunker needs to be configured on this uploader.
+func (uploader *SplitStreamUploader) RestoreStream(ctx context.Context, dstPath string, dst io.Writer) error {
+	manifest, err := uploader.loadManifest(ctx)
+	if err != nil {
+		return fmt.Errorf("loading chunk manifest: %w", err)
+	}
+
+	chunks, ok := manifest.Streams[dstPath]
+	if !ok {
+		return fmt.Errorf("no chunk manifest entry for %s", dstPath)
+	}
+
+	for _, ref := range chunks {
+		chunkPath, ok := manifest.ObjectPath(ref.Digest)
+		if !ok || chunkPath == "" {
+			return fmt.Errorf("manifest has no object recorded for chunk %s of %s", ref.Digest, dstPath)
+		}
+		if err := uploader.restoreChunk(chunkPath, dst); err != nil {
+			return fmt.Errorf("restoring chunk %s of %s: %w", ref.Digest, dstPath, err)
+		}
+	}
+	return nil
+}
+
+// restoreChunk downloads chunkPath, reverses whatever encryption and
+// compression it was uploaded with, and copies the plaintext to dst.
+func (uploader *SplitStreamUploader) restoreChunk(chunkPath string, dst io.Writer) error {
+	reader, err := uploader.Folder().ReadObject(chunkPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var content io.Reader = reader
+	if crypter := ConfigureCrypter(); crypter != nil {
+		decrypter, ok := crypter.(ChunkDecrypter)
+		if !ok {
+			return fmt.Errorf("configured crypter %T cannot decrypt deduped chunks (does not implement ChunkDecrypter)", crypter)
+		}
+		decryptedContent, err := decrypter.Decrypt(content)
+		if err != nil {
+			return fmt.Errorf("decrypting %s: %w", chunkPath, err)
+		}
+		content = decryptedContent
+	}
+
+	decompressor, ok := uploader.Compression().(ChunkDecompressor)
+	if !ok {
+		return fmt.Errorf("compressor %T cannot decode deduped chunks (does not implement ChunkDecompressor)", uploader.Compression())
+	}
+	decompressedContent, err := decompressor.NewDecompressingReader(content)
+	if err != nil {
+		return fmt.Errorf("decompressing %s: %w", chunkPath, err)
+	}
+	defer decompressedContent.Close()
+	content = decompressedContent
+
+	_, err = io.Copy(dst, content)
+	return err
+}
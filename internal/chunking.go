@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+)
+
+// gearTable is the 256-entry random table used by the FastCDC gear hash,
+// one uint64 per possible input byte. It's seeded deterministically with a
+// splitmix64 generator so chunk boundaries are reproducible across runs and
+// across processes without shipping a 256-line literal.
+var gearTable = newGearTable(0x9e3779b97f4a7c15)
+
+func newGearTable(seed uint64) [256]uint64 {
+	var table [256]uint64
+	for i := range table {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}
+
+// CDCConfig configures a ContentDefinedChunker. MinSize and MaxSize default to
+// TargetSize/4 and TargetSize*4 respectively when left at zero, per the
+// FastCDC paper's recommendation.
+type CDCConfig struct {
+	TargetSize int
+	MinSize    int
+	MaxSize    int
+}
+
+func (c CDCConfig) normalized() CDCConfig {
+	if c.TargetSize <= 0 {
+		c.TargetSize = 1 << 20 // 1 MiB
+	}
+	if c.MinSize <= 0 {
+		c.MinSize = c.TargetSize / 4
+	}
+	if c.MaxSize <= 0 {
+		c.MaxSize = c.TargetSize * 4
+	}
+	return c
+}
+
+// maskBits returns the number of low zero-bits the gear hash must have to cut
+// a chunk. FastCDC uses a tighter (more bits) mask while below TargetSize and
+// a looser one above it, which keeps the chunk-size distribution narrow -
+// this is the "normalized chunking" trick from the paper.
+func maskBits(size int) uint64 {
+	bits := 0
+	for 1<<bits < size {
+		bits++
+	}
+	return uint64(bits)
+}
+
+// ContentDefinedChunker splits a byte stream into content-defined chunks
+// using a FastCDC-style gear hash, so that inserting or deleting bytes in the
+// middle of a stream only changes the chunks adjacent to the edit.
+type ContentDefinedChunker struct {
+	cfg       CDCConfig
+	maskSmall uint64
+	maskLarge uint64
+}
+
+// NewContentDefinedChunker builds a chunker for the given configuration.
+func NewContentDefinedChunker(cfg CDCConfig) *ContentDefinedChunker {
+	cfg = cfg.normalized()
+	return &ContentDefinedChunker{
+		cfg:       cfg,
+		maskSmall: (uint64(1) << (maskBits(cfg.TargetSize) + 1)) - 1,
+		maskLarge: (uint64(1) << (maskBits(cfg.TargetSize) - 1)) - 1,
+	}
+}
+
+// Chunk splits content by content-defined boundaries, invoking onChunk for
+// each chunk in order. Chunk data passed to onChunk is only valid for the
+// duration of the call.
+func (c *ContentDefinedChunker) Chunk(content io.Reader, onChunk func(data []byte) error) error {
+	chunkBuf := make([]byte, c.cfg.MaxSize)
+
+	readMore := func() (int, error) {
+		return io.ReadFull(content, chunkBuf)
+	}
+
+	pending := bytes.NewBuffer(nil)
+	for {
+		n, readErr := readMore()
+		if n > 0 {
+			pending.Write(chunkBuf[:n])
+		}
+		for pending.Len() >= c.cfg.MaxSize || (readErr != nil && pending.Len() > 0) {
+			data := pending.Bytes()
+			cut := c.findCut(data, readErr != nil)
+			if cut == 0 {
+				break
+			}
+			chunk := make([]byte, cut)
+			copy(chunk, data[:cut])
+			if err := onChunk(chunk); err != nil {
+				return err
+			}
+			remaining := append([]byte(nil), data[cut:]...)
+			pending.Reset()
+			pending.Write(remaining)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+	if pending.Len() > 0 {
+		return onChunk(append([]byte(nil), pending.Bytes()...))
+	}
+	return nil
+}
+
+// findCut returns the length of the next chunk within data, or 0 if no
+// boundary has been found yet and more data should be buffered (unless atEOF,
+// in which case the whole buffer is returned as the final chunk).
+func (c *ContentDefinedChunker) findCut(data []byte, atEOF bool) int {
+	if len(data) <= c.cfg.MinSize {
+		if atEOF {
+			return len(data)
+		}
+		return 0
+	}
+
+	limit := len(data)
+	if limit > c.cfg.MaxSize {
+		limit = c.cfg.MaxSize
+	}
+
+	var hash uint64
+	for i := c.cfg.MinSize; i < limit; i++ {
+		hash = (hash << 1) + gearTable[data[i]]
+		mask := c.maskLarge
+		if i < c.cfg.TargetSize {
+			mask = c.maskSmall
+		}
+		if hash&mask == 0 {
+			return i + 1
+		}
+	}
+	if limit == c.cfg.MaxSize || atEOF {
+		return limit
+	}
+	return 0
+}
+
+// ChunkDigest returns the hex-encoded SHA-256 digest of a chunk, used as its
+// key in the dedup manifest.
+func ChunkDigest(chunk []byte) string {
+	sum := sha256.Sum256(chunk)
+	return hex.EncodeToString(sum[:])
+}
+
+// ChunkRef describes one chunk's position within a reassembled stream,
+// regardless of whether its bytes were freshly uploaded or deduplicated
+// against an earlier backup.
+type ChunkRef struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// ChunkManifest maps chunk digests to the object path storing their bytes,
+// and records the ordered sequence of chunks making up each stream. It is
+// persisted as a sidecar object alongside the backup it describes.
+type ChunkManifest struct {
+	// Objects maps a chunk digest to the path it was uploaded under.
+	Objects map[string]string `json:"objects"`
+	// Streams maps a stream's destination path to its ordered chunk list.
+	Streams map[string][]ChunkRef `json:"streams"`
+}
+
+// NewChunkManifest returns an empty manifest.
+func NewChunkManifest() *ChunkManifest {
+	return &ChunkManifest{
+		Objects: make(map[string]string),
+		Streams: make(map[string][]ChunkRef),
+	}
+}
+
+// Has reports whether a chunk with this digest has already been uploaded.
+func (m *ChunkManifest) Has(digest string) bool {
+	_, ok := m.Objects[digest]
+	return ok
+}
+
+// Add records a newly uploaded chunk and appends it to the stream's chunk list.
+func (m *ChunkManifest) Add(streamPath, objectPath, digest string, size int64) {
+	if _, ok := m.Objects[digest]; !ok {
+		m.Objects[digest] = objectPath
+	}
+	m.Streams[streamPath] = append(m.Streams[streamPath], ChunkRef{Digest: digest, Size: size})
+}
+
+// ObjectPath returns the object path a chunk's bytes are stored under.
+func (m *ChunkManifest) ObjectPath(digest string) (string, bool) {
+	path, ok := m.Objects[digest]
+	return path, ok
+}
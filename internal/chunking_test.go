@@ -0,0 +1,56 @@
+package internal
+
+import "testing"
+
+func TestChunkManifestDedup(t *testing.T) {
+	manifest := NewChunkManifest()
+
+	digestA := ChunkDigest([]byte("chunk a"))
+	digestB := ChunkDigest([]byte("chunk b"))
+
+	if manifest.Has(digestA) {
+		t.Fatal("Has() true before any chunk was added")
+	}
+
+	manifest.Add("stream1", "stream1.chunks/"+digestA, digestA, 7)
+	manifest.Add("stream1", "stream1.chunks/"+digestB, digestB, 7)
+
+	if !manifest.Has(digestA) {
+		t.Error("Has() false after Add()")
+	}
+
+	// A second stream referencing digestA is a dedup hit: it records no new
+	// object path, reusing the one from the first stream.
+	manifest.Add("stream2", "", digestA, 7)
+
+	path, ok := manifest.ObjectPath(digestA)
+	if !ok || path != "stream1.chunks/"+digestA {
+		t.Errorf("ObjectPath(digestA) = (%q, %v), want (%q, true)", path, ok, "stream1.chunks/"+digestA)
+	}
+
+	stream1Chunks := manifest.Streams["stream1"]
+	if len(stream1Chunks) != 2 {
+		t.Fatalf("len(Streams[stream1]) = %d, want 2", len(stream1Chunks))
+	}
+	if stream1Chunks[0].Digest != digestA || stream1Chunks[1].Digest != digestB {
+		t.Error("Streams[stream1] chunk order does not match insertion order")
+	}
+
+	stream2Chunks := manifest.Streams["stream2"]
+	if len(stream2Chunks) != 1 || stream2Chunks[0].Digest != digestA {
+		t.Errorf("Streams[stream2] = %+v, want a single chunk referencing digestA", stream2Chunks)
+	}
+}
+
+func TestChunkDigestIsDeterministicAndContentSensitive(t *testing.T) {
+	a := ChunkDigest([]byte("hello"))
+	b := ChunkDigest([]byte("hello"))
+	c := ChunkDigest([]byte("world"))
+
+	if a != b {
+		t.Error("ChunkDigest is not deterministic for identical input")
+	}
+	if a == c {
+		t.Error("ChunkDigest collided for different input")
+	}
+}
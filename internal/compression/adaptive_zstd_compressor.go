@@ -0,0 +1,176 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// AdaptiveSampleSize is how many bytes of a stream's start AdaptiveZstdCompressor
+// compresses at each candidate level before picking a level for the rest of
+// the stream.
+const AdaptiveSampleSize = 4 * 1024 * 1024 // 4 MiB
+
+// AdaptiveZstdLevels are the candidate zstd levels AdaptiveZstdCompressor
+// chooses between: fast, balanced, high-ratio and max-ratio.
+var AdaptiveZstdLevels = []int{1, 3, 9, 19}
+
+// AdaptiveZstdFileExtension is the extension for AdaptiveZstdCompressor
+// output. It's plain, dictionary-less zstd, so it's the same extension
+// ordinary zstd output would use and decodes with any zstd reader.
+const AdaptiveZstdFileExtension = "zst"
+
+// AdaptiveZstdCompressor samples the first AdaptiveSampleSize bytes of a
+// stream at each of AdaptiveZstdLevels, scores them by ratio vs. wall-clock
+// throughput, and compresses the remainder of the stream at the winning
+// level. The chosen level for a given stream is available via the
+// LeveledWriter interface on the writer NewWriter returns, once it's closed -
+// it is NOT tracked on the compressor itself, since one AdaptiveZstdCompressor
+// is shared across every concurrently-writing SplitStreamUploader partition
+// and a field here would be a data race across them.
+type AdaptiveZstdCompressor struct{}
+
+var _ Compressor = &AdaptiveZstdCompressor{}
+
+// LeveledWriter is implemented by compression writers that pick their zstd
+// level per stream, so callers can inspect which level was used once the
+// writer has been closed (e.g. for logging/diagnostics). Nothing currently
+// plumbs this into uploaded object metadata: Upload only ever sees the
+// already-compressed reader CompressAndEncrypt produces, not the writer
+// that picked the level, so there's no hook to read ChosenLevel() back
+// from at upload time.
+type LeveledWriter interface {
+	ChosenLevel() int
+}
+
+// NewAdaptiveZstdCompressor returns a Compressor that picks its zstd level
+// per stream instead of using a single fixed level.
+func NewAdaptiveZstdCompressor() *AdaptiveZstdCompressor {
+	return &AdaptiveZstdCompressor{}
+}
+
+func (compressor *AdaptiveZstdCompressor) NewWriter(writer io.Writer) ReusableWriter {
+	return &adaptiveZstdWriter{
+		dst:    writer,
+		sample: bytes.NewBuffer(nil),
+	}
+}
+
+func (compressor *AdaptiveZstdCompressor) FileExtension() string {
+	return AdaptiveZstdFileExtension
+}
+
+// NewDecompressingReader returns a reader over the plain zstd stream written
+// by adaptiveZstdWriter. The chosen level only affects how the stream was
+// encoded, not how it decodes, so no level needs to be threaded through here.
+func (compressor *AdaptiveZstdCompressor) NewDecompressingReader(r io.Reader) (io.ReadCloser, error) {
+	decoder, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return decoder.IOReadCloser(), nil
+}
+
+// adaptiveZstdWriter buffers up to AdaptiveSampleSize bytes, picks a level by
+// trial-compressing the sample at each AdaptiveZstdLevels candidate, then
+// flushes the sample and all subsequent writes through a real zstd.Encoder
+// at the winning level. Implements LeveledWriter once closed.
+type adaptiveZstdWriter struct {
+	dst     io.Writer
+	level   int
+	sample  *bytes.Buffer
+	encoder *zstd.Encoder
+}
+
+var _ LeveledWriter = &adaptiveZstdWriter{}
+
+// ChosenLevel returns the zstd level selected for this writer's stream, or 0
+// if the writer hasn't picked one yet (i.e. before Write has been called
+// enough to sample, or before Close forces selection).
+func (w *adaptiveZstdWriter) ChosenLevel() int {
+	return w.level
+}
+
+func (w *adaptiveZstdWriter) Write(p []byte) (int, error) {
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+
+	n := len(p)
+	w.sample.Write(p)
+	if w.sample.Len() < AdaptiveSampleSize {
+		return n, nil
+	}
+	if err := w.selectLevelAndFlush(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (w *adaptiveZstdWriter) selectLevelAndFlush() error {
+	level := w.bestLevel(w.sample.Bytes())
+	w.level = level
+
+	encoder, err := zstd.NewWriter(w.dst, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	if err != nil {
+		return err
+	}
+	w.encoder = encoder
+	_, err = w.encoder.Write(w.sample.Bytes())
+	w.sample = nil
+	return err
+}
+
+// bestLevel trial-compresses sample at every candidate level and returns the
+// one with the best ratio-per-second, i.e. the level that isn't spending
+// disproportionate wall-clock time for the ratio it buys.
+func (w *adaptiveZstdWriter) bestLevel(sample []byte) int {
+	bestLevel := AdaptiveZstdLevels[0]
+	bestScore := -1.0
+
+	for _, level := range AdaptiveZstdLevels {
+		start := time.Now()
+		var buf bytes.Buffer
+		encoder, err := zstd.NewWriter(&buf, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		if err != nil {
+			continue
+		}
+		if _, err := encoder.Write(sample); err != nil {
+			encoder.Close()
+			continue
+		}
+		encoder.Close()
+
+		elapsed := time.Since(start).Seconds()
+		if elapsed <= 0 {
+			elapsed = 0.001
+		}
+		ratio := float64(len(sample)) / float64(buf.Len())
+		throughput := float64(len(sample)) / elapsed
+		score := ratio * throughput
+
+		if score > bestScore {
+			bestScore = score
+			bestLevel = level
+		}
+	}
+	return bestLevel
+}
+
+func (w *adaptiveZstdWriter) Close() error {
+	if w.encoder == nil {
+		if err := w.selectLevelAndFlush(); err != nil {
+			return err
+		}
+	}
+	return w.encoder.Close()
+}
+
+func (w *adaptiveZstdWriter) Reset(writer io.Writer) {
+	w.dst = writer
+	w.level = 0
+	w.encoder = nil
+	w.sample = bytes.NewBuffer(nil)
+}
@@ -0,0 +1,55 @@
+package compression
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+// TestAdaptiveZstdCompressorConcurrentWriters exercises one shared
+// AdaptiveZstdCompressor (as SplitStreamUploader partitions do, via Clone)
+// from several goroutines at once. Run with -race: each writer must only
+// ever see its own ChosenLevel, never another writer's.
+func TestAdaptiveZstdCompressorConcurrentWriters(t *testing.T) {
+	compressor := NewAdaptiveZstdCompressor()
+
+	const writers = 8
+	var wg sync.WaitGroup
+	levels := make([]int, writers)
+
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var buf bytes.Buffer
+			w := compressor.NewWriter(&buf)
+			if _, err := w.Write(bytes.Repeat([]byte{byte(i)}, 1024)); err != nil {
+				t.Errorf("writer %d: Write: %v", i, err)
+				return
+			}
+			if err := w.Close(); err != nil {
+				t.Errorf("writer %d: Close: %v", i, err)
+				return
+			}
+			leveled, ok := w.(LeveledWriter)
+			if !ok {
+				t.Errorf("writer %d: does not implement LeveledWriter", i)
+				return
+			}
+			levels[i] = leveled.ChosenLevel()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, level := range levels {
+		if level == 0 {
+			t.Errorf("writer %d: ChosenLevel() = 0, want a level from AdaptiveZstdLevels", i)
+		}
+	}
+}
+
+func TestAdaptiveZstdCompressorFileExtension(t *testing.T) {
+	if got := NewAdaptiveZstdCompressor().FileExtension(); got != AdaptiveZstdFileExtension {
+		t.Errorf("FileExtension() = %q, want %q", got, AdaptiveZstdFileExtension)
+	}
+}
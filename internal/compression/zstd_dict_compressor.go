@@ -0,0 +1,123 @@
+package compression
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// WalgZstdDictPathSetting points at a file containing a pre-trained zstd
+// dictionary to use for ZstdDictCompressor. WAL segments are small and
+// highly repetitive, so a dictionary trained on a corpus of prior segments
+// gives an order-of-magnitude better ratio than dictionary-less zstd.
+const WalgZstdDictPathSetting = "WALG_ZSTD_DICT_PATH"
+
+// WalgZstdLevelSetting overrides the zstd compression level used by
+// ZstdDictCompressor. Defaults to zstd.SpeedDefault when unset.
+const WalgZstdLevelSetting = "WALG_ZSTD_LEVEL"
+
+const ZstdDictFileExtension = "zst"
+
+// ZstdDictCompressedFileExtension is the extension for ZstdDictCompressor
+// output. It's distinct from the plain zstd "zst" extension
+// (ZstdDictFileExtension, and AdaptiveZstdFileExtension used by
+// AdaptiveZstdCompressor) because dict-compressed output needs the matching
+// dictionary to decode - a plain zstd reader can't fall back to decoding it,
+// so restore must be able to tell the two apart from the object name alone.
+const ZstdDictCompressedFileExtension = "zst.dict"
+
+// ZstdDictCompressor compresses with zstd using a pre-trained dictionary,
+// which substantially improves ratio on small, repetitive streams such as
+// WAL segments that dictionary-less zstd can't otherwise exploit.
+//
+// Decode support is wired only through ChunkDecompressor, for objects
+// restored via the chunk-dedup path (SplitStreamUploader.RestoreStream).
+// There is no general, extension-keyed decompressor registry in this
+// codebase for the plain single-object fetch/restore path to consult, so a
+// WAL segment uploaded with this compressor outside of chunking can't yet
+// be fetched back through that path; that registry doesn't exist here to
+// hook into and adding one is out of scope for this compressor.
+type ZstdDictCompressor struct {
+	dict  []byte
+	level zstd.EncoderLevel
+}
+
+var _ Compressor = &ZstdDictCompressor{}
+
+// NewZstdDictCompressor builds a Compressor that encodes with dict at the
+// given zstd level (1-22, per github.com/klauspost/compress/zstd levels).
+func NewZstdDictCompressor(dict []byte, level int) *ZstdDictCompressor {
+	return &ZstdDictCompressor{
+		dict:  dict,
+		level: zstd.EncoderLevelFromZstd(level),
+	}
+}
+
+// NewZstdDictCompressorFromEnv builds a ZstdDictCompressor from
+// WalgZstdDictPathSetting / WalgZstdLevelSetting, returning nil if no
+// dictionary path is configured.
+func NewZstdDictCompressorFromEnv() (*ZstdDictCompressor, error) {
+	dictPath := os.Getenv(WalgZstdDictPathSetting)
+	if dictPath == "" {
+		return nil, nil
+	}
+	dict, err := os.ReadFile(dictPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", WalgZstdDictPathSetting, err)
+	}
+
+	level := 3 // EncoderLevelFromZstd(3) == zstd.SpeedDefault
+	if raw := os.Getenv(WalgZstdLevelSetting); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", WalgZstdLevelSetting, err)
+		}
+		level = parsed
+	}
+	return NewZstdDictCompressor(dict, level), nil
+}
+
+// NewWriter returns a zstd encoder seeded with the configured dictionary.
+func (compressor *ZstdDictCompressor) NewWriter(writer io.Writer) ReusableWriter {
+	encoder, err := zstd.NewWriter(
+		writer,
+		zstd.WithEncoderDict(compressor.dict),
+		zstd.WithEncoderLevel(compressor.level),
+	)
+	if err != nil {
+		// Matches the package-level zstd compressor's behavior of treating
+		// encoder construction failure as unrecoverable. WithEncoderDict
+		// parses the dictionary here, so a dictionary that isn't a valid
+		// zstd dictionary (e.g. a bad WALG_ZSTD_DICT_PATH file) panics.
+		panic(err)
+	}
+	return encoder
+}
+
+func (compressor *ZstdDictCompressor) FileExtension() string {
+	return ZstdDictCompressedFileExtension
+}
+
+// NewDecompressingReader returns a reader over a stream written by NewWriter,
+// seeded with the same dictionary so the encoder's back-references resolve.
+func (compressor *ZstdDictCompressor) NewDecompressingReader(r io.Reader) (io.ReadCloser, error) {
+	decoder, err := zstd.NewReader(r, zstd.WithDecoderDicts(compressor.dict))
+	if err != nil {
+		return nil, err
+	}
+	return decoder.IOReadCloser(), nil
+}
+
+// DictDigest returns the hex-encoded SHA-256 digest of the dictionary this
+// compressor was built with, so it can be recorded alongside an object (e.g.
+// as metadata, or folded into its manifest entry) to confirm restore has the
+// matching dictionary before attempting to decode.
+func (compressor *ZstdDictCompressor) DictDigest() string {
+	sum := sha256.Sum256(compressor.dict)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,32 @@
+package compression
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestZstdDictCompressorFileExtensionDiffersFromAdaptive(t *testing.T) {
+	dictCompressor := NewZstdDictCompressor([]byte("some dictionary bytes"), 3)
+	if got := dictCompressor.FileExtension(); got != ZstdDictCompressedFileExtension {
+		t.Errorf("FileExtension() = %q, want %q", got, ZstdDictCompressedFileExtension)
+	}
+	if dictCompressor.FileExtension() == NewAdaptiveZstdCompressor().FileExtension() {
+		t.Error("dict-compressed and plain adaptive zstd output must use different extensions")
+	}
+}
+
+func TestZstdDictCompressorDictDigest(t *testing.T) {
+	dict := []byte("some dictionary bytes")
+	compressor := NewZstdDictCompressor(dict, 3)
+
+	want := sha256.Sum256(dict)
+	if got := compressor.DictDigest(); got != hex.EncodeToString(want[:]) {
+		t.Errorf("DictDigest() = %s, want %s", got, hex.EncodeToString(want[:]))
+	}
+
+	other := NewZstdDictCompressor([]byte("a different dictionary"), 3)
+	if compressor.DictDigest() == other.DictDigest() {
+		t.Error("DictDigest() should differ for different dictionaries")
+	}
+}
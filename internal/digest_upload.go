@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/wal-g/tracelog"
+)
+
+// ChecksumFolder is implemented by storage folders whose backend SDK can
+// compute and send an end-to-end integrity checksum as it streams an
+// upload (S3's trailing x-amz-checksum-crc32c, GCS's x-goog-hash), so the
+// server rejects a corrupted upload instead of silently accepting it.
+// checksumAlgorithm names the algorithm to request, e.g. "CRC32C".
+type ChecksumFolder interface {
+	PutObjectWithChecksum(ctx context.Context, path string, content io.Reader, checksumAlgorithm string) error
+}
+
+// RenameableFolder is implemented by storage folders that can rename an
+// object without a client-side download/re-upload round trip.
+type RenameableFolder interface {
+	RenameObject(ctx context.Context, srcPath, dstPath string) error
+}
+
+// uploadDigester tees an upload stream through SHA-256 so the digest can be
+// recorded and verified once the upload completes. A CRC32C digest isn't
+// computed here too: ChecksumFolder already has the backend SDK compute and
+// verify that checksum as it streams, so a second, local CRC32C pass would
+// only be logged, not actually checked against anything.
+type uploadDigester struct {
+	io.Reader
+	sha256 hash.Hash
+}
+
+func newUploadDigester(content io.Reader) *uploadDigester {
+	d := &uploadDigester{sha256: sha256.New()}
+	d.Reader = io.TeeReader(content, d.sha256)
+	return d
+}
+
+func (d *uploadDigester) sha256Hex() string {
+	return hex.EncodeToString(d.sha256.Sum(nil))
+}
+
+// checksumAlgorithm is the server-side checksum algorithm requested from a
+// ChecksumFolder for digest-verified uploads.
+const checksumAlgorithm = "CRC32C"
+
+// putWithDigest performs the actual PutObject call for a digest-verified
+// upload, routing through ChecksumFolder (if the backend supports it) so the
+// checksum is sent as part of the same streaming pass rather than requiring
+// the whole object to be buffered up front.
+func (uploader *RegularUploader) putWithDigest(ctx context.Context, path string, content io.Reader) error {
+	if checksumFolder, ok := uploader.UploadingFolder.(ChecksumFolder); ok {
+		return checksumFolder.PutObjectWithChecksum(ctx, path, content, checksumAlgorithm)
+	}
+	return uploader.UploadingFolder.PutObjectWithContext(ctx, path, content)
+}
+
+// finishDigestVerification records the digest computed while uploadPath was
+// uploaded, renames the object to a digest-suffixed, content-addressable name
+// when ContentAddressableNaming is set, and writes the .sha256 sidecar
+// against whichever name the object actually ends up at - so the sidecar and
+// LastUploadPath never point callers at an orphaned, pre-rename path.
+func (uploader *RegularUploader) finishDigestVerification(ctx context.Context, uploadPath string, digester *uploadDigester) error {
+	digest := digester.sha256Hex()
+	tracelog.DebugLogger.Printf("%s: sha256=%s", uploadPath, digest)
+
+	uploader.digestMu.Lock()
+	uploader.lastDigest = digest
+	uploader.digestMu.Unlock()
+
+	finalPath := uploadPath
+	if uploader.ContentAddressableNaming {
+		renameableFolder, ok := uploader.UploadingFolder.(RenameableFolder)
+		if !ok {
+			tracelog.WarningLogger.Printf("folder does not support renaming, leaving %s without a digest suffix", uploadPath)
+		} else {
+			digestPath := uploadPath + "." + digest
+			if err := renameableFolder.RenameObject(ctx, uploadPath, digestPath); err != nil {
+				return fmt.Errorf("renaming %s to %s: %w", uploadPath, digestPath, err)
+			}
+			finalPath = digestPath
+		}
+	}
+
+	uploader.digestMu.Lock()
+	uploader.lastPath = finalPath
+	uploader.digestMu.Unlock()
+
+	sidecarPath := finalPath + ".sha256"
+	if err := uploader.UploadingFolder.PutObjectWithContext(ctx, sidecarPath, strings.NewReader(digest)); err != nil {
+		tracelog.WarningLogger.Printf("could not write sha256 sidecar for %s: %v", finalPath, err)
+	}
+	return nil
+}
+
+// LastUploadDigest returns the SHA-256 digest of the most recently uploaded
+// object, hex-encoded, so callers (e.g. sentinel construction) can embed a
+// digest for every included object. Returns "" if VerifyDigest was never
+// enabled or no upload has completed yet.
+func (uploader *RegularUploader) LastUploadDigest() string {
+	uploader.digestMu.Lock()
+	defer uploader.digestMu.Unlock()
+	return uploader.lastDigest
+}
+
+// LastUploadPath returns the path of the most recently uploaded object,
+// reflecting any ContentAddressableNaming rename, so callers that need the
+// object's final name (not just its digest) don't have to reconstruct it.
+// Returns "" if VerifyDigest was never enabled or no upload has completed yet.
+func (uploader *RegularUploader) LastUploadPath() string {
+	uploader.digestMu.Lock()
+	defer uploader.digestMu.Unlock()
+	return uploader.lastPath
+}
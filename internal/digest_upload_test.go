@@ -0,0 +1,23 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+)
+
+func TestUploadDigesterMatchesStandaloneHash(t *testing.T) {
+	data := []byte("the quick brown fox jumps over the lazy dog")
+
+	digester := newUploadDigester(bytes.NewReader(data))
+	if _, err := io.Copy(io.Discard, digester); err != nil {
+		t.Fatalf("reading through digester: %v", err)
+	}
+
+	wantSHA256 := sha256.Sum256(data)
+	if got := digester.sha256Hex(); got != hex.EncodeToString(wantSHA256[:]) {
+		t.Errorf("sha256Hex() = %s, want %s", got, hex.EncodeToString(wantSHA256[:]))
+	}
+}
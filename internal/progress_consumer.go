@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/wal-g/tracelog"
+)
+
+// progressReportInterval bounds how often a ProgressConsumer receives
+// OnProgress calls for a single object, so multi-hour uploads don't spam the
+// consumer with a callback per byte.
+const progressReportInterval = 250 * time.Millisecond // 4 Hz
+
+// ProgressConsumer receives upload lifecycle and throughput events so CLI
+// users can render an ETA/throughput display and programmatic callers can
+// drive their own UIs or metrics sinks. Implementations must be safe for
+// concurrent use: SplitStreamUploader reports progress for several
+// partitions at once.
+type ProgressConsumer interface {
+	OnStart(path string, totalBytes int64)
+	OnProgress(path string, uploaded int64)
+	OnFinish(path string, err error)
+	Logf(format string, args ...interface{})
+	Debugf(format string, args ...interface{})
+}
+
+// NopProgressConsumer discards all progress events. RegularUploader uses it
+// when Progress is nil; NewRegularUploader sets TraceLogProgressConsumer.
+type NopProgressConsumer struct{}
+
+func (NopProgressConsumer) OnStart(path string, totalBytes int64)   {}
+func (NopProgressConsumer) OnProgress(path string, uploaded int64)  {}
+func (NopProgressConsumer) OnFinish(path string, err error)         {}
+func (NopProgressConsumer) Logf(format string, args ...interface{}) {}
+func (NopProgressConsumer) Debugf(format string, args ...interface{}) {
+}
+
+var _ ProgressConsumer = NopProgressConsumer{}
+
+// TraceLogProgressConsumer renders progress through tracelog, which is the
+// logger every other WAL-G subsystem already writes to.
+type TraceLogProgressConsumer struct{}
+
+func (TraceLogProgressConsumer) OnStart(path string, totalBytes int64) {
+	tracelog.InfoLogger.Printf("upload started: %s (%d bytes)", path, totalBytes)
+}
+
+func (TraceLogProgressConsumer) OnProgress(path string, uploaded int64) {
+	tracelog.InfoLogger.Printf("upload progress: %s (%d bytes)", path, uploaded)
+}
+
+func (TraceLogProgressConsumer) OnFinish(path string, err error) {
+	if err != nil {
+		tracelog.ErrorLogger.Printf("upload failed: %s: %v", path, err)
+		return
+	}
+	tracelog.InfoLogger.Printf("upload finished: %s", path)
+}
+
+func (TraceLogProgressConsumer) Logf(format string, args ...interface{}) {
+	tracelog.InfoLogger.Printf(format, args...)
+}
+
+func (TraceLogProgressConsumer) Debugf(format string, args ...interface{}) {
+	tracelog.DebugLogger.Printf(format, args...)
+}
+
+var _ ProgressConsumer = TraceLogProgressConsumer{}
+
+// progressReader wraps an io.Reader, reporting OnStart/OnProgress/OnFinish
+// to a ProgressConsumer at progressReportInterval.
+type progressReader struct {
+	io.Reader
+	consumer ProgressConsumer
+	path     string
+	read     int64
+	lastSent time.Time
+	finished atomic.Bool
+}
+
+// newProgressReader wraps content so reads through it are reported to
+// consumer for path, which has totalBytes bytes (-1 if unknown).
+func newProgressReader(content io.Reader, consumer ProgressConsumer, path string, totalBytes int64) io.Reader {
+	if consumer == nil {
+		consumer = NopProgressConsumer{}
+	}
+	consumer.OnStart(path, totalBytes)
+	return &progressReader{Reader: content, consumer: consumer, path: path}
+}
+
+// readerSize best-effort determines how many bytes remain to be read from r,
+// mirroring the approach net/http uses to infer a request's Content-Length:
+// recognize well-known sized types directly, then fall back to io.Seeker.
+// Returns -1 if the size can't be determined without consuming r.
+func readerSize(r io.Reader) int64 {
+	switch v := r.(type) {
+	case *bytes.Buffer:
+		return int64(v.Len())
+	case *bytes.Reader:
+		return int64(v.Len())
+	case *strings.Reader:
+		return int64(v.Len())
+	}
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return -1
+	}
+	current, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1
+	}
+	if _, err := seeker.Seek(current, io.SeekStart); err != nil {
+		return -1
+	}
+	return end - current
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.read += int64(n)
+		if now := time.Now(); now.Sub(r.lastSent) >= progressReportInterval {
+			r.lastSent = now
+			r.consumer.OnProgress(r.path, r.read)
+		}
+	}
+	if err != nil && r.finished.CompareAndSwap(false, true) {
+		if err == io.EOF {
+			r.consumer.OnFinish(r.path, nil)
+		} else {
+			r.consumer.OnFinish(r.path, err)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReaderSize(t *testing.T) {
+	if got := readerSize(bytes.NewReader([]byte("hello world"))); got != 11 {
+		t.Errorf("readerSize(*bytes.Reader) = %d, want 11", got)
+	}
+	if got := readerSize(strings.NewReader("hi")); got != 2 {
+		t.Errorf("readerSize(*strings.Reader) = %d, want 2", got)
+	}
+	if got := readerSize(bytes.NewBufferString("abcde")); got != 5 {
+		t.Errorf("readerSize(*bytes.Buffer) = %d, want 5", got)
+	}
+	if got := readerSize(io.LimitReader(bytes.NewReader([]byte("x")), 1)); got != -1 {
+		t.Errorf("readerSize(unseekable, unsized reader) = %d, want -1", got)
+	}
+}
+
+func TestReaderSizePreservesSeekPosition(t *testing.T) {
+	r := bytes.NewReader([]byte("0123456789"))
+	if _, err := r.Seek(3, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+
+	if got := readerSize(r); got != 7 {
+		t.Errorf("readerSize() = %d, want 7", got)
+	}
+
+	b := make([]byte, 1)
+	if _, err := r.Read(b); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if string(b) != "3" {
+		t.Errorf("readerSize left the reader at position %q, want to still be at '3'", b)
+	}
+}
+
+func TestNewRegularUploaderDefaultsToTraceLogProgress(t *testing.T) {
+	uploader := NewRegularUploader(nil, nil)
+	if _, ok := uploader.Progress.(TraceLogProgressConsumer); !ok {
+		t.Errorf("NewRegularUploader default Progress = %T, want TraceLogProgressConsumer", uploader.Progress)
+	}
+}
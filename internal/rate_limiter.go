@@ -0,0 +1,226 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRateLimitCooldown is how long an adaptive rate limiter waits after
+// halving its rate before it starts additively increasing it again (AIMD).
+const DefaultRateLimitCooldown = 30 * time.Second
+
+// rateLimiter is a simple token-bucket limiter: tokens (bytes) accrue at
+// ratePerSec up to burst, and Wait blocks until n tokens are available.
+// It additionally implements AIMD adaptive backoff: throttle halves the
+// current rate, and once DefaultRateLimitCooldown has passed since the last
+// throttle, recordSuccess additively restores it towards the configured rate.
+type rateLimiter struct {
+	mu          sync.Mutex
+	rate        float64 // bytes/sec, the possibly-throttled current rate
+	configured  float64 // bytes/sec, the rate configured by the user
+	burst       float64
+	tokens      float64
+	last        time.Time
+	throttledAt time.Time
+}
+
+// newRateLimiter returns nil (no limiting) when bytesPerSec <= 0.
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	rate := float64(bytesPerSec)
+	return &rateLimiter{
+		rate:       rate,
+		configured: rate,
+		burst:      rate, // allow bursting up to one second's worth
+		tokens:     rate,
+		last:       time.Now(),
+	}
+}
+
+func (l *rateLimiter) refill() {
+	now := time.Now()
+	elapsed := now.Sub(l.last).Seconds()
+	l.last = now
+	l.tokens += elapsed * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// wait blocks until n bytes' worth of tokens are available, or ctx is done.
+// For n larger than burst it waits for a full bucket and takes the rest as
+// debt, which later waits pay back.
+func (l *rateLimiter) wait(ctx context.Context, n int64) error {
+	need := float64(n)
+	if need > l.burst {
+		need = l.burst
+	}
+	for {
+		l.mu.Lock()
+		l.refill()
+		if l.tokens >= need {
+			l.tokens -= float64(n)
+			l.mu.Unlock()
+			return nil
+		}
+		deficit := need - l.tokens
+		sleepFor := time.Duration(deficit / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(sleepFor):
+		}
+	}
+}
+
+// throttle halves the effective rate for DefaultRateLimitCooldown, in
+// response to a backend signaling it's overloaded (HTTP 503 / SlowDown).
+func (l *rateLimiter) throttle() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate /= 2
+	if l.rate < 1 {
+		l.rate = 1
+	}
+	l.throttledAt = time.Now()
+}
+
+// recordSuccess additively restores rate towards configured once the
+// cooldown window since the last throttle has elapsed (AIMD recovery).
+func (l *rateLimiter) recordSuccess() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate >= l.configured {
+		return
+	}
+	if time.Since(l.throttledAt) < DefaultRateLimitCooldown {
+		return
+	}
+	l.rate += l.configured * 0.1
+	if l.rate > l.configured {
+		l.rate = l.configured
+	}
+}
+
+// isThrottlingError reports whether err looks like a storage backend telling
+// us to slow down (S3 SlowDown / 503, GCS 429/503).
+func isThrottlingError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "SlowDown") ||
+		strings.Contains(msg, "503") ||
+		strings.Contains(msg, "429") ||
+		strings.Contains(msg, "TooManyRequests")
+}
+
+// rateLimitedReader wraps an io.Reader so that reads are throttled to the
+// limiter's current rate.
+type rateLimitedReader struct {
+	io.Reader
+	ctx     context.Context
+	limiter *rateLimiter
+}
+
+func newRateLimitedReader(ctx context.Context, r io.Reader, limiter *rateLimiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	return &rateLimitedReader{Reader: r, ctx: ctx, limiter: limiter}
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.wait(r.ctx, int64(n)); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// inflightLimiter bounds the number of bytes that may be buffered for
+// in-progress uploads at once, so PushStream's producer blocks instead of
+// spawning unbounded goroutines when the backend can't keep up.
+type inflightLimiter struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	capacity int64
+	inUse    int64
+}
+
+// newInflightLimiter returns nil (no limiting) when maxBytes <= 0.
+func newInflightLimiter(maxBytes int64) *inflightLimiter {
+	if maxBytes <= 0 {
+		return nil
+	}
+	l := &inflightLimiter{capacity: maxBytes}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire blocks until n bytes of budget are available.
+func (l *inflightLimiter) acquire(n int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.inUse+n > l.capacity && l.inUse > 0 {
+		l.cond.Wait()
+	}
+	l.inUse += n
+}
+
+// release returns n bytes of budget, waking any blocked acquirers.
+func (l *inflightLimiter) release(n int64) {
+	l.mu.Lock()
+	l.inUse -= n
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+// inflightReader wraps an io.Reader, acquiring inflight budget for each
+// chunk as it's read and releasing the previous chunk's budget first, so
+// what's "in flight" at any moment is bounded by this reader's current
+// buffer rather than the whole object's size. Accumulating budget across an
+// object's entire lifetime (only releasing once the upload finishes) would
+// self-deadlock for any object bigger than MaxInflightBytes: acquire would
+// block waiting for a release that can't happen until the same blocked Read
+// returns.
+type inflightReader struct {
+	io.Reader
+	limiter *inflightLimiter
+	total   int64
+}
+
+func newInflightReader(r io.Reader, limiter *inflightLimiter) *inflightReader {
+	return &inflightReader{Reader: r, limiter: limiter}
+}
+
+func (r *inflightReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 && r.limiter != nil {
+		if r.total > 0 {
+			r.limiter.release(r.total)
+		}
+		r.limiter.acquire(int64(n))
+		r.total = int64(n)
+	}
+	return n, err
+}
+
+// release returns whatever budget this reader is still holding, e.g. after
+// the last Read returned io.EOF or the upload otherwise stopped reading.
+func (r *inflightReader) release() {
+	if r.limiter == nil || r.total == 0 {
+		return
+	}
+	r.limiter.release(r.total)
+	r.total = 0
+}
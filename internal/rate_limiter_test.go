@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestInflightReaderDoesNotDeadlockPastCapacity(t *testing.T) {
+	limiter := newInflightLimiter(8)
+	data := bytes.Repeat([]byte("x"), 64)
+	reader := newInflightReader(bytes.NewReader(data), limiter)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, reader)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("io.Copy: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("reading an object larger than MaxInflightBytes deadlocked")
+	}
+	reader.release()
+}
+
+func TestRateLimiterThrottleHalvesRateAndClampsToOne(t *testing.T) {
+	l := newRateLimiter(10)
+	l.throttle()
+	if l.rate != 5 {
+		t.Errorf("rate after one throttle = %v, want 5", l.rate)
+	}
+
+	l = newRateLimiter(1)
+	l.throttle()
+	if l.rate != 1 {
+		t.Errorf("rate should clamp to 1, got %v", l.rate)
+	}
+}
+
+func TestRateLimiterRecordSuccessWaitsOutCooldown(t *testing.T) {
+	l := newRateLimiter(100)
+	l.throttle()
+	if l.rate != 50 {
+		t.Fatalf("rate after throttle = %v, want 50", l.rate)
+	}
+
+	// Cooldown hasn't elapsed yet: recordSuccess must not restore anything.
+	l.recordSuccess()
+	if l.rate != 50 {
+		t.Errorf("rate changed before cooldown elapsed: %v, want 50", l.rate)
+	}
+
+	// Simulate the cooldown window having passed.
+	l.throttledAt = time.Now().Add(-DefaultRateLimitCooldown - time.Second)
+	l.recordSuccess()
+	if l.rate <= 50 {
+		t.Errorf("rate did not increase after cooldown elapsed: %v", l.rate)
+	}
+	if l.rate > l.configured {
+		t.Errorf("rate overshot configured: %v > %v", l.rate, l.configured)
+	}
+}
+
+func TestRateLimiterRecordSuccessNoOpWhenNotThrottled(t *testing.T) {
+	l := newRateLimiter(100)
+	l.recordSuccess()
+	if l.rate != l.configured {
+		t.Errorf("rate = %v, want unchanged configured rate %v", l.rate, l.configured)
+	}
+}
+
+func TestInflightLimiterBoundsConcurrentUsage(t *testing.T) {
+	limiter := newInflightLimiter(16)
+
+	limiter.acquire(16)
+	acquired := make(chan struct{})
+	go func() {
+		limiter.acquire(1)
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquire should have blocked while capacity is fully used")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	limiter.release(16)
+	select {
+	case <-acquired:
+	case <-time.After(2 * time.Second):
+		t.Fatal("acquire did not unblock after release")
+	}
+}
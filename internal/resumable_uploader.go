@@ -0,0 +1,444 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/ioextensions"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// DefaultMinPartSize is the smallest part size ResumableUploader will negotiate,
+// matching the S3 multipart upload minimum.
+const DefaultMinPartSize = 5 * 1024 * 1024
+
+// DefaultMaxParts is the largest number of parts a single multipart upload may have,
+// per the S3 multipart upload limit.
+const DefaultMaxParts = 10000
+
+// DefaultPartConcurrency bounds how many parts ResumableUploader uploads at once.
+const DefaultPartConcurrency = 4
+
+// DefaultPartUploadRetries bounds how many times a single part's upload is
+// attempted, the first try included, before its error is allowed to fail
+// the whole upload, so a transient error
+// on one part doesn't lose an otherwise-complete backup.
+const DefaultPartUploadRetries = 3
+
+// MultipartFolder is implemented by storage folders that support multipart
+// (resumable) uploads. Folders that don't implement it cause ResumableUploader
+// to fall back to a single-shot PutObjectWithContext.
+type MultipartFolder interface {
+	CreateMultipartUpload(ctx context.Context, path string) (uploadID string, err error)
+	UploadPart(ctx context.Context, path, uploadID string, partNumber int, content io.Reader) (etag string, err error)
+	CompleteMultipartUpload(ctx context.Context, path, uploadID string, parts []CompletedPart) error
+	AbortMultipartUpload(ctx context.Context, path, uploadID string) error
+}
+
+// CompletedPart identifies a single uploaded part by its position and ETag.
+type CompletedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+// partCheckpoint records everything needed to verify and skip a previously
+// uploaded part on resume.
+type partCheckpoint struct {
+	Number int    `json:"number"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	ETag   string `json:"etag"`
+}
+
+// uploadCheckpoint is persisted as a sidecar object next to the in-progress
+// upload so ResumableUploader can resume across process restarts.
+type uploadCheckpoint struct {
+	Path     string           `json:"path"`
+	UploadID string           `json:"upload_id"`
+	Parts    []partCheckpoint `json:"parts"`
+}
+
+func checkpointPath(path string) string {
+	return path + ".resumable-checkpoint.json"
+}
+
+// ResumableUploader is an Uploader that performs multipart uploads and
+// checkpoints progress after every successful part, so a backup interrupted
+// by a pod restart or network blip can resume instead of starting over.
+// Only Upload and UploadFile are checkpointed: PushStream and
+// PushStreamToDestination come from the embedded RegularUploader and go
+// through its single-shot Upload.
+type ResumableUploader struct {
+	*RegularUploader
+
+	MinPartSize     int
+	MaxParts        int
+	PartConcurrency int
+}
+
+var _ Uploader = &ResumableUploader{}
+
+// NewResumableUploader wraps a RegularUploader with multipart checkpoint/restart support.
+func NewResumableUploader(
+	compressor compression.Compressor,
+	uploadingLocation storage.Folder,
+) *ResumableUploader {
+	return &ResumableUploader{
+		RegularUploader: NewRegularUploader(compressor, uploadingLocation),
+		MinPartSize:     DefaultMinPartSize,
+		MaxParts:        DefaultMaxParts,
+		PartConcurrency: DefaultPartConcurrency,
+	}
+}
+
+// Clone creates a similar ResumableUploader with a new WaitGroup.
+func (uploader *ResumableUploader) Clone() Uploader {
+	return &ResumableUploader{
+		RegularUploader: uploader.RegularUploader.Clone().(*RegularUploader),
+		MinPartSize:     uploader.MinPartSize,
+		MaxParts:        uploader.MaxParts,
+		PartConcurrency: uploader.PartConcurrency,
+	}
+}
+
+// Upload performs a checkpointed multipart upload of content to path. Every
+// part read from content is hashed and compared against the checkpoint (if
+// any) left by a previous attempt at the same path: parts whose hash and
+// size still match are reused as-is (no re-upload), and the first part that
+// doesn't match is where the upload actually resumes. If the checkpoint's
+// very first part no longer matches - i.e. nothing from the previous attempt
+// is reusable - the stale multipart upload is aborted and a fresh one takes
+// its place; otherwise the existing upload ID is reused and parts from the
+// mismatch point on are (re-)uploaded into it. Folders that don't implement
+// MultipartFolder fall back to the RegularUploader behavior.
+func (uploader *ResumableUploader) Upload(ctx context.Context, path string, content io.Reader) error {
+	multipartFolder, ok := uploader.UploadingFolder.(MultipartFolder)
+	if !ok {
+		return uploader.RegularUploader.Upload(ctx, path, content)
+	}
+
+	uploader.waitGroup.Add(1)
+	defer uploader.waitGroup.Done()
+
+	checkpoint, err := uploader.loadCheckpoint(ctx, path)
+	if err != nil {
+		tracelog.WarningLogger.Printf("could not load checkpoint for %s, starting fresh: %v", path, err)
+		checkpoint = nil
+	}
+	if checkpoint != nil && checkpoint.Path != path {
+		checkpoint = nil
+	}
+
+	checkpointByNumber := make(map[int]partCheckpoint)
+	uploadID := ""
+	if checkpoint != nil {
+		uploadID = checkpoint.UploadID
+		for _, p := range checkpoint.Parts {
+			checkpointByNumber[p.Number] = p
+		}
+	}
+	if uploadID == "" {
+		if uploadID, err = multipartFolder.CreateMultipartUpload(ctx, path); err != nil {
+			uploader.failed.Store(true)
+			return fmt.Errorf("starting multipart upload of %s: %w", path, err)
+		}
+	}
+
+	var (
+		mu            sync.Mutex
+		wg            sync.WaitGroup
+		sem           = make(chan struct{}, uploader.partConcurrency())
+		partsByNumber = make(map[int]partCheckpoint)
+		matchedAny    bool
+		stillMatching = len(checkpointByNumber) > 0
+		firstErr      error
+		partNumber    int
+		offset        int64
+	)
+	recordErr := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+	hasErr := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+readLoop:
+	for !hasErr() {
+		buf := make([]byte, uploader.partSize())
+		n, readErr := io.ReadFull(content, buf)
+		if n == 0 {
+			if readErr != nil && readErr != io.EOF {
+				recordErr(fmt.Errorf("reading part %d of %s: %w", partNumber+1, path, readErr))
+			}
+			break
+		}
+
+		partNumber++
+		if partNumber > uploader.maxParts() {
+			recordErr(fmt.Errorf("upload of %s exceeds MaxParts (%d)", path, uploader.maxParts()))
+			break
+		}
+
+		data := buf[:n]
+		digest := ChunkDigest(data)
+		partOffset := offset
+		offset += int64(n)
+		atEnd := readErr == io.EOF || readErr == io.ErrUnexpectedEOF
+		readFailed := readErr != nil && !atEnd
+
+		if stillMatching {
+			cp, known := checkpointByNumber[partNumber]
+			switch resumePartDecision(known, matchedAny, cp, int64(n), digest) {
+			case resumeReuse:
+				matchedAny = true
+				mu.Lock()
+				partsByNumber[partNumber] = cp
+				mu.Unlock()
+				if readFailed {
+					recordErr(fmt.Errorf("reading part %d of %s: %w", partNumber, path, readErr))
+				}
+				if atEnd || readFailed {
+					break readLoop
+				}
+				continue readLoop
+			case resumeAbortStale:
+				// The checkpoint's first part no longer matches, so nothing
+				// from the previous attempt is reusable: abort it rather
+				// than layering new parts onto an upload describing a
+				// different stream.
+				if abortErr := multipartFolder.AbortMultipartUpload(ctx, path, uploadID); abortErr != nil {
+					tracelog.WarningLogger.Printf("aborting stale multipart upload of %s: %v", path, abortErr)
+				}
+				newUploadID, createErr := multipartFolder.CreateMultipartUpload(ctx, path)
+				if createErr != nil {
+					recordErr(fmt.Errorf("restarting multipart upload of %s: %w", path, createErr))
+					break readLoop
+				}
+				uploadID = newUploadID
+				stillMatching = false
+			case resumeContinue:
+				// Either the checkpoint didn't get this far last time (no
+				// part recorded at this position) or it did but diverged
+				// after some earlier parts had already matched; either way
+				// the existing upload ID is still good to append to.
+				stillMatching = false
+			}
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(uploadID string, number int, data []byte, digest string, partOffset int64, readFailed bool, readErr error, atEnd bool) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			etag, uploadErr := uploader.uploadPartWithRetry(ctx, multipartFolder, path, uploadID, number, data)
+			if uploadErr != nil {
+				recordErr(fmt.Errorf("uploading part %d of %s: %w", number, path, uploadErr))
+				return
+			}
+
+			// Hold mu for the snapshot-and-save together, not just the map
+			// update: otherwise two goroutines' saves can interleave and the
+			// one with the smaller (earlier) snapshot can land last,
+			// persisting a checkpoint that forgets an already-uploaded part.
+			mu.Lock()
+			partsByNumber[number] = partCheckpoint{
+				Number: number,
+				Offset: partOffset,
+				Size:   int64(len(data)),
+				SHA256: digest,
+				ETag:   etag,
+			}
+			snapshot := checkpointSnapshot(partsByNumber)
+			if err := uploader.saveCheckpoint(ctx, path, uploadID, snapshot); err != nil {
+				tracelog.WarningLogger.Printf("could not persist checkpoint for %s: %v", path, err)
+			}
+			mu.Unlock()
+			if readFailed {
+				recordErr(fmt.Errorf("reading part %d of %s: %w", number, path, readErr))
+			}
+		}(uploadID, partNumber, append([]byte(nil), data...), digest, partOffset, readFailed, readErr, atEnd)
+
+		if atEnd || readFailed {
+			break
+		}
+	}
+
+	wg.Wait()
+	if err := firstErrOf(&mu, &firstErr); err != nil {
+		uploader.failed.Store(true)
+		return err
+	}
+
+	mu.Lock()
+	parts := checkpointSnapshot(partsByNumber)
+	mu.Unlock()
+
+	completed := make([]CompletedPart, 0, len(parts))
+	for _, p := range parts {
+		completed = append(completed, CompletedPart{PartNumber: p.Number, ETag: p.ETag})
+	}
+	if err := multipartFolder.CompleteMultipartUpload(ctx, path, uploadID, completed); err != nil {
+		uploader.failed.Store(true)
+		return fmt.Errorf("completing multipart upload of %s: %w", path, err)
+	}
+	uploader.deleteCheckpoint(ctx, path)
+	return nil
+}
+
+// resumeOutcome is the result of comparing a freshly-read part against the
+// checkpoint left by a previous upload attempt at the same part number.
+type resumeOutcome int
+
+const (
+	// resumeReuse means the part's size and digest match the checkpoint
+	// exactly: it was already uploaded, so reuse its ETag instead of
+	// re-uploading.
+	resumeReuse resumeOutcome = iota
+	// resumeAbortStale means the checkpoint's very first part doesn't match
+	// what's now being read: none of it can be trusted, so the stale
+	// multipart upload should be aborted and a new one started.
+	resumeAbortStale
+	// resumeContinue means checkpoint comparison is done (either this part
+	// was never recorded, or it diverged after earlier parts did match) and
+	// the part should be uploaded into the existing upload ID.
+	resumeContinue
+)
+
+// resumePartDecision decides what to do with a part at the position checked
+// against checkpoint, given whether checkpoint held a part there (known),
+// whether any earlier part in this attempt already matched its checkpoint
+// (matchedAny), and the freshly-read part's size and digest.
+func resumePartDecision(known, matchedAny bool, checkpoint partCheckpoint, size int64, digest string) resumeOutcome {
+	if known && checkpoint.Size == size && checkpoint.SHA256 == digest {
+		return resumeReuse
+	}
+	if known && !matchedAny {
+		return resumeAbortStale
+	}
+	return resumeContinue
+}
+
+func firstErrOf(mu *sync.Mutex, errPtr *error) error {
+	mu.Lock()
+	defer mu.Unlock()
+	return *errPtr
+}
+
+// checkpointSnapshot returns the parts in partsByNumber sorted by part
+// number, suitable for persisting or for CompleteMultipartUpload.
+func checkpointSnapshot(partsByNumber map[int]partCheckpoint) []partCheckpoint {
+	parts := make([]partCheckpoint, 0, len(partsByNumber))
+	for _, p := range partsByNumber {
+		parts = append(parts, p)
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+	return parts
+}
+
+// uploadPartWithRetry retries a single part's upload so a transient error
+// doesn't have to fail (and restart) the entire backup.
+func (uploader *ResumableUploader) uploadPartWithRetry(
+	ctx context.Context,
+	folder MultipartFolder,
+	path, uploadID string,
+	partNumber int,
+	data []byte,
+) (string, error) {
+	var lastErr error
+	for attempt := 1; attempt <= uploader.partRetries(); attempt++ {
+		etag, err := folder.UploadPart(ctx, path, uploadID, partNumber, bytes.NewReader(data))
+		if err == nil {
+			return etag, nil
+		}
+		lastErr = err
+		tracelog.WarningLogger.Printf(
+			"part %d of %s failed (attempt %d/%d): %v", partNumber, path, attempt, uploader.partRetries(), err)
+	}
+	return "", lastErr
+}
+
+func (uploader *ResumableUploader) partSize() int {
+	if uploader.MinPartSize <= 0 {
+		return DefaultMinPartSize
+	}
+	return uploader.MinPartSize
+}
+
+func (uploader *ResumableUploader) maxParts() int {
+	if uploader.MaxParts <= 0 {
+		return DefaultMaxParts
+	}
+	return uploader.MaxParts
+}
+
+func (uploader *ResumableUploader) partConcurrency() int {
+	if uploader.PartConcurrency <= 0 {
+		return 1
+	}
+	return uploader.PartConcurrency
+}
+
+func (uploader *ResumableUploader) partRetries() int {
+	return DefaultPartUploadRetries
+}
+
+func (uploader *ResumableUploader) loadCheckpoint(ctx context.Context, path string) (*uploadCheckpoint, error) {
+	exists, err := uploader.UploadingFolder.Exists(checkpointPath(path))
+	if err != nil || !exists {
+		return nil, err
+	}
+	reader, err := uploader.UploadingFolder.ReadObject(checkpointPath(path))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var checkpoint uploadCheckpoint
+	if err := json.NewDecoder(reader).Decode(&checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+func (uploader *ResumableUploader) saveCheckpoint(ctx context.Context, path, uploadID string, parts []partCheckpoint) error {
+	checkpoint := uploadCheckpoint{Path: path, UploadID: uploadID, Parts: parts}
+	body, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	return uploader.UploadingFolder.PutObjectWithContext(ctx, checkpointPath(path), bytes.NewReader(body))
+}
+
+func (uploader *ResumableUploader) deleteCheckpoint(ctx context.Context, path string) {
+	if err := uploader.UploadingFolder.DeleteObjects([]string{checkpointPath(path)}); err != nil {
+		tracelog.WarningLogger.Printf("could not remove checkpoint for %s: %v", path, err)
+	}
+}
+
+// UploadFile compresses a file and performs a checkpointed resumable upload of it.
+func (uploader *ResumableUploader) UploadFile(ctx context.Context, file ioextensions.NamedReader) error {
+	fileReader := file.(io.Reader)
+	if uploader.dataSize != nil {
+		fileReader = utility.NewWithSizeReader(fileReader, uploader.dataSize)
+	}
+	compressedFile := CompressAndEncrypt(fileReader, uploader.Compressor, ConfigureCrypter())
+	dstPath := utility.SanitizePath(filepath.Base(file.Name()) + "." + uploader.Compressor.FileExtension())
+	return uploader.Upload(ctx, dstPath, compressedFile)
+}
@@ -0,0 +1,92 @@
+package internal
+
+import "testing"
+
+func TestResumePartDecision(t *testing.T) {
+	matching := partCheckpoint{Number: 3, Size: 10, SHA256: "abc"}
+
+	tests := []struct {
+		name       string
+		known      bool
+		matchedAny bool
+		size       int64
+		digest     string
+		want       resumeOutcome
+	}{
+		{
+			name:   "matching size and digest is reused",
+			known:  true,
+			size:   matching.Size,
+			digest: matching.SHA256,
+			want:   resumeReuse,
+		},
+		{
+			name:       "first part mismatch aborts the stale upload",
+			known:      true,
+			matchedAny: false,
+			size:       999,
+			digest:     "different",
+			want:       resumeAbortStale,
+		},
+		{
+			name:       "later part mismatch continues on the same upload",
+			known:      true,
+			matchedAny: true,
+			size:       999,
+			digest:     "different",
+			want:       resumeContinue,
+		},
+		{
+			name:   "part never recorded by the checkpoint continues",
+			known:  false,
+			size:   10,
+			digest: "abc",
+			want:   resumeContinue,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resumePartDecision(tt.known, tt.matchedAny, matching, tt.size, tt.digest)
+			if got != tt.want {
+				t.Errorf("resumePartDecision() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckpointSnapshotOrdersByPartNumber(t *testing.T) {
+	partsByNumber := map[int]partCheckpoint{
+		3: {Number: 3},
+		1: {Number: 1},
+		2: {Number: 2},
+	}
+
+	snapshot := checkpointSnapshot(partsByNumber)
+	if len(snapshot) != 3 {
+		t.Fatalf("len(snapshot) = %d, want 3", len(snapshot))
+	}
+	for i, p := range snapshot {
+		if p.Number != i+1 {
+			t.Errorf("snapshot[%d].Number = %d, want %d", i, p.Number, i+1)
+		}
+	}
+}
+
+func TestResumableUploaderDefaults(t *testing.T) {
+	uploader := &ResumableUploader{}
+	if got := uploader.partSize(); got != DefaultMinPartSize {
+		t.Errorf("partSize() = %d, want %d", got, DefaultMinPartSize)
+	}
+	if got := uploader.maxParts(); got != DefaultMaxParts {
+		t.Errorf("maxParts() = %d, want %d", got, DefaultMaxParts)
+	}
+	if got := uploader.partConcurrency(); got != 1 {
+		t.Errorf("partConcurrency() = %d, want 1", got)
+	}
+
+	uploader.PartConcurrency = 8
+	if got := uploader.partConcurrency(); got != 8 {
+		t.Errorf("partConcurrency() = %d, want 8", got)
+	}
+}
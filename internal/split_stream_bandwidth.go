@@ -0,0 +1,29 @@
+package internal
+
+// SetBandwidthLimits configures the RateLimit (bytes/sec, 0 = unlimited) and
+// MaxInflightBytes (0 = unlimited) of the RegularUploader backing this
+// SplitStreamUploader, however deeply it's wrapped.
+func (uploader *SplitStreamUploader) SetBandwidthLimits(rateLimit, maxInflightBytes int64) {
+	regular := findRegularUploader(uploader.Uploader)
+	if regular == nil {
+		return
+	}
+	regular.RateLimit = rateLimit
+	regular.MaxInflightBytes = maxInflightBytes
+}
+
+// findRegularUploader unwraps nested Uploaders (e.g. a SplitStreamUploader
+// wrapping another SplitStreamUploader) to find the underlying
+// RegularUploader that actually talks to storage.
+func findRegularUploader(uploader Uploader) *RegularUploader {
+	switch u := uploader.(type) {
+	case *RegularUploader:
+		return u
+	case *SplitStreamUploader:
+		return findRegularUploader(u.Uploader)
+	case *ResumableUploader:
+		return u.RegularUploader
+	default:
+		return nil
+	}
+}
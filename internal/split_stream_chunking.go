@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/wal-g/tracelog"
+)
+
+// chunkManifestName is the sidecar object holding the dedup manifest shared
+// by every stream pushed into a given backup-set folder.
+const chunkManifestName = "chunk-manifest.json"
+
+// EnableContentDefinedChunking sets the FastCDC content-defined chunker,
+// built from the given config, that PushStreamToDestinationDeduped uses to
+// split streams and dedup chunks against the manifest already present in
+// the destination folder, if any. PushStream and PushStreamToDestination
+// don't use the chunker and still split at fixed blockSize boundaries.
+func (uploader *SplitStreamUploader) EnableContentDefinedChunking(cfg CDCConfig) {
+	uploader.chunker = NewContentDefinedChunker(cfg)
+}
+
+// PushStreamToDestinationDeduped chunks stream with content-defined
+// boundaries and uploads only chunks whose digest isn't already present in
+// the backup-set's manifest, writing the (possibly updated) manifest back
+// when done. Novel chunks are routed through CompressAndEncrypt like any
+// other upload, so dedup doesn't come at the cost of compression or
+// encryption. If EnableContentDefinedChunking hasn't been called, it falls
+// back to PushStreamToDestination without dedup.
+// See RestoreStream for the inverse operation.
+func (uploader *SplitStreamUploader) PushStreamToDestinationDeduped(ctx context.Context, stream io.Reader, dstPath string) error {
+	if uploader.chunker == nil {
+		return uploader.PushStreamToDestination(ctx, stream, dstPath)
+	}
+
+	manifest, err := uploader.loadManifest(ctx)
+	if err != nil {
+		tracelog.WarningLogger.Printf("could not load chunk manifest, starting fresh: %v", err)
+		manifest = NewChunkManifest()
+	}
+
+	uploaded := 0
+	deduped := 0
+	chunkErr := uploader.chunker.Chunk(stream, func(data []byte) error {
+		digest := ChunkDigest(data)
+		if manifest.Has(digest) {
+			deduped++
+			manifest.Add(dstPath, "", digest, int64(len(data)))
+			return nil
+		}
+		chunkPath := fmt.Sprintf("%s.chunks/%s", dstPath, digest)
+		compressed := CompressAndEncrypt(bytes.NewReader(data), uploader.Compression(), ConfigureCrypter())
+		if err := uploader.Upload(ctx, chunkPath, compressed); err != nil {
+			return fmt.Errorf("uploading chunk %s: %w", digest, err)
+		}
+		manifest.Add(dstPath, chunkPath, digest, int64(len(data)))
+		uploaded++
+		return nil
+	})
+	if chunkErr != nil {
+		return chunkErr
+	}
+
+	tracelog.InfoLogger.Printf("%s: uploaded %d new chunks, deduped %d chunks", dstPath, uploaded, deduped)
+	return uploader.saveManifest(ctx, manifest)
+}
+
+func (uploader *SplitStreamUploader) loadManifest(ctx context.Context) (*ChunkManifest, error) {
+	exists, err := uploader.Folder().Exists(chunkManifestName)
+	if err != nil || !exists {
+		return NewChunkManifest(), err
+	}
+	reader, err := uploader.Folder().ReadObject(chunkManifestName)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	manifest := NewChunkManifest()
+	if err := json.NewDecoder(reader).Decode(manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func (uploader *SplitStreamUploader) saveManifest(ctx context.Context, manifest *ChunkManifest) error {
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	return uploader.Folder().PutObjectWithContext(ctx, chunkManifestName, bytes.NewReader(body))
+}
@@ -40,10 +40,44 @@ type Uploader interface {
 type RegularUploader struct {
 	UploadingFolder storage.Folder
 	Compressor      compression.Compressor
-	waitGroup       *sync.WaitGroup
-	failed          atomic.Bool
-	tarSize         *int64
-	dataSize        *int64
+	Progress        ProgressConsumer
+	// VerifyDigest opts in to computing a streaming SHA-256 (and CRC32C,
+	// when the folder supports ChecksumFolder) while uploading, rejecting
+	// the upload on backend checksum mismatch and recording the digest for
+	// LastUploadDigest and a .sha256 sidecar. See digest_upload.go.
+	VerifyDigest bool
+	// ContentAddressableNaming, combined with VerifyDigest, additionally
+	// renames the uploaded object to include its digest as a suffix once
+	// the digest is known, on folders implementing RenameableFolder.
+	ContentAddressableNaming bool
+	// RateLimit caps upload throughput in bytes/sec (0 = unlimited). On
+	// repeated 503/SlowDown errors from the backend the effective rate is
+	// halved for a cool-down window, then additively restored (AIMD). See
+	// rate_limiter.go.
+	RateLimit int64
+	// MaxInflightBytes caps how many bytes of in-progress uploads may be
+	// buffered at once; once reached, Upload's reader blocks instead of
+	// letting producers run unbounded.
+	MaxInflightBytes int64
+	waitGroup        *sync.WaitGroup
+	failed           atomic.Bool
+	tarSize          *int64
+	dataSize         *int64
+	digestMu         sync.Mutex
+	lastDigest       string
+	lastPath         string
+	limiterOnce      sync.Once
+	rateLimiter      *rateLimiter
+	inflightLimiter  *inflightLimiter
+}
+
+// ensureLimiters lazily builds rateLimiter/inflightLimiter from the
+// RateLimit/MaxInflightBytes fields on first use.
+func (uploader *RegularUploader) ensureLimiters() {
+	uploader.limiterOnce.Do(func() {
+		uploader.rateLimiter = newRateLimiter(uploader.RateLimit)
+		uploader.inflightLimiter = newInflightLimiter(uploader.MaxInflightBytes)
+	})
 }
 
 var _ Uploader = &RegularUploader{}
@@ -56,6 +90,11 @@ type SplitStreamUploader struct {
 	partitions  int
 	blockSize   int
 	maxFileSize int
+	// chunker, when set via EnableContentDefinedChunking, gives
+	// PushStreamToDestinationDeduped FastCDC content-defined chunk
+	// boundaries and dedup against the backup-set's chunk manifest. Other
+	// push methods keep fixed blockSize splitting.
+	chunker *ContentDefinedChunker
 }
 
 var _ Uploader = &SplitStreamUploader{}
@@ -73,6 +112,7 @@ func NewRegularUploader(
 	uploader := &RegularUploader{
 		UploadingFolder: uploadingLocation,
 		Compressor:      compressor,
+		Progress:        TraceLogProgressConsumer{},
 		waitGroup:       &sync.WaitGroup{},
 		tarSize:         new(int64),
 		dataSize:        new(int64),
@@ -128,14 +168,26 @@ func (uploader *RegularUploader) Finish() {
 // Clone creates similar Uploader with new WaitGroup
 func (uploader *RegularUploader) Clone() Uploader {
 	clone := &RegularUploader{
-		UploadingFolder: uploader.UploadingFolder,
-		Compressor:      uploader.Compressor,
-		waitGroup:       &sync.WaitGroup{},
-		failed:          atomic.Bool{},
-		tarSize:         uploader.tarSize,
-		dataSize:        uploader.dataSize,
+		UploadingFolder:          uploader.UploadingFolder,
+		Compressor:               uploader.Compressor,
+		Progress:                 uploader.Progress,
+		VerifyDigest:             uploader.VerifyDigest,
+		ContentAddressableNaming: uploader.ContentAddressableNaming,
+		RateLimit:                uploader.RateLimit,
+		MaxInflightBytes:         uploader.MaxInflightBytes,
+		waitGroup:                &sync.WaitGroup{},
+		failed:                   atomic.Bool{},
+		tarSize:                  uploader.tarSize,
+		dataSize:                 uploader.dataSize,
 	}
 	clone.failed.Store(uploader.Failed())
+	// Share this uploader's limiters (once built) so the configured rate/
+	// inflight budget applies across every tarball sharing the backup, not
+	// per clone.
+	uploader.ensureLimiters()
+	clone.rateLimiter = uploader.rateLimiter
+	clone.inflightLimiter = uploader.inflightLimiter
+	clone.limiterOnce.Do(func() {})
 	return clone
 }
 
@@ -174,19 +226,63 @@ func (uploader *RegularUploader) Upload(ctx context.Context, path string, conten
 	defer statistics.PushMetrics()
 
 	statistics.WalgMetrics.UploadedFilesTotal.Inc()
+	totalBytes := readerSize(content)
 	if uploader.tarSize != nil {
 		content = utility.NewWithSizeReader(content, uploader.tarSize)
 	}
-	err := uploader.UploadingFolder.PutObjectWithContext(ctx, path, content)
+	content = newProgressReader(content, uploader.progressConsumer(), path, totalBytes)
+
+	uploader.ensureLimiters()
+	content = newRateLimitedReader(ctx, content, uploader.rateLimiter)
+	inflight := newInflightReader(content, uploader.inflightLimiter)
+	content = inflight
+	defer inflight.release()
+
+	var digester *uploadDigester
+	if uploader.VerifyDigest {
+		digester = newUploadDigester(content)
+		content = digester
+	}
+
+	uploadPath := path
+	var err error
+	if digester != nil {
+		err = uploader.putWithDigest(ctx, uploadPath, content)
+	} else {
+		err = uploader.UploadingFolder.PutObjectWithContext(ctx, uploadPath, content)
+	}
 	if err != nil {
 		statistics.WalgMetrics.UploadedFilesFailedTotal.Inc()
 		uploader.failed.Load()
 		tracelog.ErrorLogger.Printf(tracelog.GetErrorFormatter()+"\n", err)
+		if uploader.rateLimiter != nil && isThrottlingError(err) {
+			uploader.rateLimiter.throttle()
+			tracelog.WarningLogger.Printf("backend signaled overload uploading %s, halving upload rate", uploadPath)
+		}
 		return err
 	}
+	if uploader.rateLimiter != nil {
+		uploader.rateLimiter.recordSuccess()
+	}
+
+	if digester != nil {
+		if err := uploader.finishDigestVerification(ctx, uploadPath, digester); err != nil {
+			tracelog.ErrorLogger.Printf("digest verification for %s: %v", uploadPath, err)
+			return err
+		}
+	}
 	return nil
 }
 
+// progressConsumer returns the configured ProgressConsumer, or a no-op one
+// if none was set (e.g. an uploader constructed without NewRegularUploader).
+func (uploader *RegularUploader) progressConsumer() ProgressConsumer {
+	if uploader.Progress == nil {
+		return NopProgressConsumer{}
+	}
+	return uploader.Progress
+}
+
 // UploadMultiple uploads multiple objects from the start of the slice,
 // returning the first error if any. Note that this operation is not atomic
 // TODO : unit tests / is it used?
@@ -218,5 +314,6 @@ func (uploader *SplitStreamUploader) Clone() Uploader {
 		Uploader:   uploader.Uploader.Clone(),
 		partitions: uploader.partitions,
 		blockSize:  uploader.blockSize,
+		chunker:    uploader.chunker,
 	}
 }